@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Permission scopes understood by requireScope.
+const (
+	scopeDataRead   = "data.read"
+	scopeDataWrite  = "data.write"
+	scopeDataDelete = "data.delete"
+	scopeStatsRead  = "stats.read"
+)
+
+var errInsufficientScope = errors.New("token lacks required permission")
+
+// claims is the JWT payload minted by Authenticator and checked by
+// requireScope.
+type claims struct {
+	jwt.RegisteredClaims
+	Permissions []string `json:"permissions"`
+}
+
+// credential is one entry in the static credentials file used by
+// POST /auth/token.
+type credential struct {
+	Username    string   `json:"username"`
+	Password    string   `json:"password"`
+	Permissions []string `json:"permissions"`
+}
+
+// Authenticator issues and validates HS256 tokens against a static set of
+// credentials loaded from disk.
+type Authenticator struct {
+	secret      []byte
+	tokenTTL    time.Duration
+	credentials map[string]credential
+}
+
+// NewAuthenticator loads credentials from path (a JSON array of credential
+// objects) and returns an Authenticator that signs tokens with secret.
+func NewAuthenticator(path string, secret []byte, tokenTTL time.Duration) (*Authenticator, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: read credentials file: %w", err)
+	}
+
+	var creds []credential
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, fmt.Errorf("auth: decode credentials file: %w", err)
+	}
+
+	byUsername := make(map[string]credential, len(creds))
+	for _, c := range creds {
+		byUsername[c.Username] = c
+	}
+
+	return &Authenticator{secret: secret, tokenTTL: tokenTTL, credentials: byUsername}, nil
+}
+
+// Mint validates username/password against the credentials file and, on
+// success, returns a signed JWT carrying that user's permissions.
+func (a *Authenticator) Mint(username, password string) (string, error) {
+	cred, ok := a.credentials[username]
+	if !ok || cred.Password != password {
+		return "", errors.New("auth: invalid credentials")
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Permissions: cred.Permissions,
+	})
+
+	signed, err := token.SignedString(a.secret)
+	if err != nil {
+		return "", fmt.Errorf("auth: sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// verify parses and validates a token string, returning its claims.
+func (a *Authenticator) verify(tokenString string) (*claims, error) {
+	parsed, err := jwt.ParseWithClaims(tokenString, &claims{}, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return a.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c, ok := parsed.Claims.(*claims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("auth: invalid token")
+	}
+	return c, nil
+}
+
+// tokenHandler backs POST /auth/token: it mints a JWT for valid static
+// credentials. It's an Endpoint so failures come back as the same
+// ErrResponse JSON body as every other route.
+func (a *Authenticator) tokenHandler(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, "bad request body")
+	}
+
+	token, err := a.Mint(req.Username, req.Password)
+	if err != nil {
+		return NewAPIError(http.StatusUnauthorized, err, "invalid credentials")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// requireScope wraps next so that it only runs when the request carries a
+// valid token with the given permission scope. The token may be supplied via
+// an "Authorization: Bearer <token>" header or a "token" query parameter.
+// Rejections are written as ErrResponse JSON, matching every other route.
+func (a *Authenticator) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := bearerToken(r)
+		if tokenString == "" {
+			writeError(w, r, NewAPIError(http.StatusUnauthorized, errors.New("missing token"), "missing token"))
+			return
+		}
+
+		c, err := a.verify(tokenString)
+		if err != nil {
+			writeError(w, r, NewAPIError(http.StatusUnauthorized, err, "invalid or expired token"))
+			return
+		}
+
+		if !hasPermission(c.Permissions, scope) {
+			writeError(w, r, NewAPIError(http.StatusForbidden, errInsufficientScope, errInsufficientScope.Error()))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+func hasPermission(permissions []string, scope string) bool {
+	for _, p := range permissions {
+		if p == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// APIError pairs an HTTP status with an internal error and a message safe to
+// show to callers. Handlers return one of these (via Endpoint) instead of
+// writing the response body directly.
+type APIError struct {
+	Status  int
+	Err     error
+	Message string
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// NewAPIError wraps err with the HTTP status and caller-facing message to
+// send back.
+func NewAPIError(status int, err error, message string) *APIError {
+	return &APIError{Status: status, Err: err, Message: message}
+}
+
+// ErrResponse is the JSON body written for any error returned by an
+// Endpoint.
+type ErrResponse struct {
+	Status    int    `json:"status"`
+	Err       string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Endpoint is an http.HandlerFunc that can return an error instead of
+// writing it to the response itself; ServeHTTP funnels that error into a
+// uniform ErrResponse body.
+type Endpoint func(w http.ResponseWriter, r *http.Request) error
+
+func (e Endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := e(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		apiErr = NewAPIError(http.StatusInternalServerError, err, "internal server error")
+	}
+
+	resp := ErrResponse{
+		Status:    apiErr.Status,
+		Message:   apiErr.Message,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if apiErr.Err != nil {
+		resp.Err = apiErr.Err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// fnvHex returns a fixed-width hex digest of key, used by fsStore to pick a
+// shard directory. It doesn't need to be cryptographic, just well-distributed.
+func fnvHex(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	clientSendBuffer = 16
+	pingInterval     = 30 * time.Second
+	pongWait         = 60 * time.Second
+	writeWait        = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// This is a small internal tool; accept upgrades from anywhere.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// dataEvent is broadcast to every connected client whenever a key is written
+// or removed.
+type dataEvent struct {
+	Op    string `json:"op"` // "put", "delete" or "cas"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	TS    int64  `json:"ts"`
+}
+
+// client wraps one websocket connection with a buffered outgoing queue so a
+// slow reader can't block the hub's broadcast loop.
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// hub fans dataEvents out to every registered client and owns the single
+// goroutine that mutates its client set.
+type hub struct {
+	register   chan *client
+	unregister chan *client
+	broadcast  chan []byte
+	clients    map[*client]bool
+	done       chan struct{}
+}
+
+func newHub() *hub {
+	return &hub{
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		broadcast:  make(chan []byte),
+		clients:    make(map[*client]bool),
+		done:       make(chan struct{}),
+	}
+}
+
+// run is the hub's single goroutine loop; call it with `go h.run()`.
+func (h *hub) run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+		case c := <-h.unregister:
+			if _, ok := h.clients[c]; ok {
+				delete(h.clients, c)
+				close(c.send)
+			}
+		case msg := <-h.broadcast:
+			for c := range h.clients {
+				select {
+				case c.send <- msg:
+				default:
+					// Slow consumer: drop it instead of blocking the hub.
+					delete(h.clients, c)
+					close(c.send)
+				}
+			}
+		case <-h.done:
+			for c := range h.clients {
+				delete(h.clients, c)
+				close(c.send)
+				c.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// shutdown stops the hub's loop and closes all connected clients.
+func (h *hub) shutdown() {
+	close(h.done)
+}
+
+// publish encodes evt and enqueues it for broadcast to all clients.
+func (h *hub) publish(evt dataEvent) {
+	raw, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("hub: failed to encode event: %v", err)
+		return
+	}
+	select {
+	case h.broadcast <- raw:
+	case <-h.done:
+	}
+}
+
+// serveWS upgrades the request to a websocket and registers a client with
+// the hub for the lifetime of the connection. Like publish, the register
+// send is guarded by h.done so a client connecting during shutdown doesn't
+// block forever on a hub that has already stopped its run loop.
+func (h *hub) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("hub: upgrade failed: %v", err)
+		return
+	}
+
+	c := &client{conn: conn, send: make(chan []byte, clientSendBuffer)}
+	select {
+	case h.register <- c:
+	case <-h.done:
+		conn.Close()
+		return
+	}
+
+	go c.writePump()
+	go c.readPump(h)
+}
+
+// readPump keeps the connection's read deadline fresh via pongs and drops
+// the client (unregistering it from the hub) once the socket errors out.
+// Clients aren't expected to send anything meaningful; this is just the
+// other half of the ping/pong keepalive. The unregister send is guarded by
+// h.done the same way register and publish are: shutdown closing every
+// client's conn makes ReadMessage error out here too, and by then run has
+// already exited and nothing is left to receive on h.unregister.
+func (c *client) readPump(h *hub) {
+	defer func() {
+		select {
+		case h.unregister <- c:
+		case <-h.done:
+		}
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump drains the client's send channel to the socket and issues
+// periodic pings; it exits (and closes the connection) once send is closed
+// by the hub.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,105 +1,277 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Server struct {
-	mu         sync.Mutex
-	data       map[string]string
-	requests   int
+	store Store
+	hub   *hub
+
+	draining   int32 // set via atomic; 1 once shutdown has begun
 	shutdownCh chan struct{}
 }
 
-func NewServer() *Server {
-	return &Server{
-		data:       make(map[string]string),
+// NewServer wires a Server around store, which now owns all locking around
+// the underlying data instead of Server holding a single map directly.
+func NewServer(store Store) *Server {
+	s := &Server{
+		store:      store,
+		hub:        newHub(),
 		shutdownCh: make(chan struct{}),
 	}
+	go s.hub.run()
+	return s
+}
+
+// beginDrain marks the server as shutting down so drainGuard starts
+// rejecting new writes while reads keep being served.
+func (s *Server) beginDrain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *Server) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// drainGuard rejects write requests with 503 once the server has started
+// shutting down, while letting reads keep working until the listener
+// actually stops.
+func (s *Server) drainGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isWrite := r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodDelete
+		if isWrite && s.isDraining() {
+			writeError(w, r, NewAPIError(http.StatusServiceUnavailable, errors.New("server is shutting down"), "server is shutting down, try again shortly"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (s *Server) postDataHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
+func (s *Server) postDataHandler(w http.ResponseWriter, r *http.Request) error {
+	var payload map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, "bad request body")
+	}
+
+	for key, value := range payload {
+		if err := s.store.Put(key, value); err != nil {
+			return NewAPIError(http.StatusInternalServerError, err, "failed to store data")
+		}
+		kvOperationsTotal.WithLabelValues("put").Inc()
+		s.hub.publish(dataEvent{Op: "put", Key: key, Value: value, TS: time.Now().Unix()})
 	}
 
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// bulkPutHandler backs POST /data/bulk: unlike postDataHandler, it hands the
+// whole payload to Store.BulkPut in one call instead of looping over
+// individual Put calls; how atomic that write is depends on the backend (see
+// Store.BulkPut).
+func (s *Server) bulkPutHandler(w http.ResponseWriter, r *http.Request) error {
 	var payload map[string]string
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
-		return
+		return NewAPIError(http.StatusBadRequest, err, "bad request body")
+	}
+
+	if err := s.store.BulkPut(payload); err != nil {
+		return NewAPIError(http.StatusInternalServerError, err, "failed to store data")
 	}
 
-	s.mu.Lock()
 	for key, value := range payload {
-		s.data[key] = value
+		kvOperationsTotal.WithLabelValues("put").Inc()
+		s.hub.publish(dataEvent{Op: "put", Key: key, Value: value, TS: time.Now().Unix()})
 	}
-	s.requests++
-	s.mu.Unlock()
 
 	w.WriteHeader(http.StatusCreated)
+	return nil
 }
 
-func (s *Server) getDataHandler(w http.ResponseWriter, r *http.Request) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// getDataHandler returns the full key/value dump by default. Passing
+// ?prefix=, ?cursor= or ?limit= switches to a paginated prefix scan instead,
+// returning {"items": [...], "next_cursor": "..."}.
+func (s *Server) getDataHandler(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	prefix, cursor, limitParam := q.Get("prefix"), q.Get("cursor"), q.Get("limit")
+
+	if prefix == "" && cursor == "" && limitParam == "" {
+		data := make(map[string]string)
+		err := s.store.Iterate(func(key, value string) error {
+			data[key] = value
+			return nil
+		})
+		if err != nil {
+			return NewAPIError(http.StatusInternalServerError, err, "failed to read data")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(data)
+	}
+
+	limit := 100
+	if limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			return NewAPIError(http.StatusBadRequest, errors.New("invalid limit"), "limit must be a positive integer")
+		}
+		limit = parsed
+	}
+
+	items, nextCursor, err := s.store.ListPrefix(prefix, cursor, limit)
+	if err != nil {
+		return NewAPIError(http.StatusInternalServerError, err, "failed to scan data")
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.data)
-	s.requests++
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":       items,
+		"next_cursor": nextCursor,
+	})
 }
 
-func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// putKeyHandler stores a single key via PUT /data/{key}, optionally expiring
+// it after the duration given in ?ttl= (e.g. "30s").
+func (s *Server) putKeyHandler(w http.ResponseWriter, r *http.Request) error {
+	key := chi.URLParam(r, "key")
+	if key == "" {
+		return NewAPIError(http.StatusBadRequest, errors.New("missing key"), "key is required")
+	}
 
-	stats := map[string]int{
-		"requests":      s.requests,
-		"database_size": len(s.data),
+	var body struct {
+		Value string `json:"value"`
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
-	s.requests++
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, "bad request body")
+	}
+
+	ttl, err := parseTTL(r.URL.Query().Get("ttl"))
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, err, "invalid ttl")
+	}
+
+	if err := s.store.PutTTL(key, body.Value, ttl); err != nil {
+		return NewAPIError(http.StatusInternalServerError, err, "failed to store data")
+	}
+	kvOperationsTotal.WithLabelValues("put").Inc()
+	s.hub.publish(dataEvent{Op: "put", Key: key, Value: body.Value, TS: time.Now().Unix()})
+
+	w.WriteHeader(http.StatusOK)
+	return nil
 }
 
-func (s *Server) deleteDataHandler(w http.ResponseWriter, r *http.Request) {
-	key := r.URL.Path[len("/data/"):]
+// parseTTL interprets an empty string as "no expiry".
+func parseTTL(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(raw)
+}
 
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
-		return
+// casHandler backs POST /data/cas: it swaps key's value to New only if its
+// current value equals Expected.
+func (s *Server) casHandler(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Key      string `json:"key"`
+		Expected string `json:"expected"`
+		New      string `json:"new"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return NewAPIError(http.StatusBadRequest, err, "bad request body")
+	}
+	if req.Key == "" {
+		return NewAPIError(http.StatusBadRequest, errors.New("missing key"), "key is required")
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	swapped, err := s.store.CAS(req.Key, req.Expected, req.New)
+	if err != nil {
+		return NewAPIError(http.StatusInternalServerError, err, "failed to apply compare-and-swap")
+	}
+	if !swapped {
+		return NewAPIError(http.StatusConflict, errors.New("current value did not match expected"), "compare-and-swap failed: current value did not match expected")
+	}
+
+	kvOperationsTotal.WithLabelValues("cas").Inc()
+	s.hub.publish(dataEvent{Op: "cas", Key: req.Key, Value: req.New, TS: time.Now().Unix()})
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
 
-	if _, exists := s.data[key]; !exists {
-		http.Error(w, "Key not found", http.StatusNotFound)
-		return
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) error {
+	storeStats, err := s.store.Stats()
+	if err != nil {
+		return NewAPIError(http.StatusInternalServerError, err, "failed to read stats")
+	}
+
+	stats := map[string]int64{
+		"database_size": int64(storeStats.Keys),
+		"store_bytes":   storeStats.Size,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(stats)
+}
+
+func (s *Server) deleteDataHandler(w http.ResponseWriter, r *http.Request) error {
+	key := chi.URLParam(r, "key")
+	if key == "" {
+		return NewAPIError(http.StatusBadRequest, errors.New("missing key"), "key is required")
+	}
+
+	if err := s.store.Delete(key); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return NewAPIError(http.StatusNotFound, err, "key not found")
+		}
+		return NewAPIError(http.StatusInternalServerError, err, "failed to delete key")
 	}
-	delete(s.data, key)
-	s.requests++
+	kvOperationsTotal.WithLabelValues("delete").Inc()
+	s.hub.publish(dataEvent{Op: "delete", Key: key, TS: time.Now().Unix()})
+
 	w.WriteHeader(http.StatusOK)
+	return nil
 }
 
-func (s *Server) startBackgroundWorker() {
+// startBackgroundWorker runs until shutdownCh is closed, calling wg.Done
+// exactly once on exit so callers can wait for it to drain alongside the
+// HTTP server.
+func (s *Server) startBackgroundWorker(wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			s.mu.Lock()
-			log.Printf("Server status: requests=%d, database_size=%d", s.requests, len(s.data))
-			s.mu.Unlock()
+			if fs, ok := s.store.(*fsStore); ok {
+				if err := fs.sweepExpired(); err != nil {
+					log.Printf("expiry sweep failed: %v", err)
+				}
+			}
+
+			storeStats, err := s.store.Stats()
+			if err != nil {
+				log.Printf("Server status: failed to read store stats: %v", err)
+				continue
+			}
+			kvStoreSize.Set(float64(storeStats.Keys))
 		case <-s.shutdownCh:
 			log.Println("Background worker stopping...")
 			return
@@ -107,31 +279,75 @@ func (s *Server) startBackgroundWorker() {
 	}
 }
 
+// shutdown begins the shutdown sequence: new writes start getting 503s via
+// drainGuard, and the background worker is told to stop.
 func (s *Server) shutdown() {
 	log.Println("Shutting down server...")
+	s.beginDrain()
 	close(s.shutdownCh)
+	s.hub.shutdown()
+}
+
+// newStore builds the Store selected by -store, creating its backing
+// directory under -data-dir if needed.
+func newStore(kind, dataDir string) (Store, error) {
+	switch kind {
+	case "fs":
+		return NewFSStore(dataDir)
+	case "badger":
+		return NewBadgerStore(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown -store %q (want \"fs\" or \"badger\")", kind)
+	}
 }
 
 func main() {
-	server := NewServer()
+	storeKind := flag.String("store", "fs", `storage backend: "fs" or "badger"`)
+	dataDir := flag.String("data-dir", "./data", "directory where the store persists data")
+	credentialsFile := flag.String("credentials-file", "./credentials.json", "static credentials file used to mint tokens")
+	jwtSecret := flag.String("jwt-secret", "", "HMAC secret used to sign/verify tokens (required)")
+	tokenTTL := flag.Duration("token-ttl", time.Hour, "lifetime of minted tokens")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "how long to wait for in-flight requests to drain on shutdown")
+	flag.Parse()
+
+	store, err := newStore(*storeKind, *dataDir)
+	if err != nil {
+		log.Fatalf("failed to initialize store: %v", err)
+	}
+
+	if *jwtSecret == "" {
+		log.Fatal("missing -jwt-secret")
+	}
+	authenticator, err := NewAuthenticator(*credentialsFile, []byte(*jwtSecret), *tokenTTL)
+	if err != nil {
+		log.Fatalf("failed to initialize authenticator: %v", err)
+	}
+
+	server := NewServer(store)
+
+	router := chi.NewRouter()
+	router.Use(chimiddleware.RequestID)
+	router.Use(chimiddleware.Logger)
+	router.Use(chimiddleware.Recoverer)
+	router.Use(metricsMiddleware)
 
 	// Регистрация обработчиков
-	http.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			server.postDataHandler(w, r)
-		case http.MethodGet:
-			server.getDataHandler(w, r)
-		default:
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		}
-	})
-	http.HandleFunc("/data/", server.deleteDataHandler) // Удаление по ключу
-	http.HandleFunc("/stats", server.statsHandler)
+	router.Handle("/metrics", promhttp.Handler())
+	router.Post("/auth/token", Endpoint(authenticator.tokenHandler).ServeHTTP)
+	router.Get("/data", authenticator.requireScope(scopeDataRead, Endpoint(server.getDataHandler).ServeHTTP))
+	router.Post("/data", authenticator.requireScope(scopeDataWrite, Endpoint(server.postDataHandler).ServeHTTP))
+	router.Post("/data/bulk", authenticator.requireScope(scopeDataWrite, Endpoint(server.bulkPutHandler).ServeHTTP))
+	router.Post("/data/cas", authenticator.requireScope(scopeDataWrite, Endpoint(server.casHandler).ServeHTTP))
+	router.Put("/data/{key}", authenticator.requireScope(scopeDataWrite, Endpoint(server.putKeyHandler).ServeHTTP))
+	router.Delete("/data/{key}", authenticator.requireScope(scopeDataDelete, Endpoint(server.deleteDataHandler).ServeHTTP)) // Удаление по ключу
+	router.Get("/stats", authenticator.requireScope(scopeStatsRead, Endpoint(server.statsHandler).ServeHTTP))
+	router.Get("/ws", authenticator.requireScope(scopeDataRead, server.hub.serveWS))
 
-	go server.startBackgroundWorker()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go server.startBackgroundWorker(&wg)
 
-	srv := &http.Server{Addr: ":8080"}
+	srv := &http.Server{Addr: ":8080", Handler: server.drainGuard(router)}
 
 	go func() {
 		log.Println("Server starting on :8080")
@@ -146,6 +362,17 @@ func main() {
 
 	server.shutdown()
 
-	srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server did not drain cleanly: %v", err)
+	}
+
+	wg.Wait()
+
+	if err := store.Close(); err != nil {
+		log.Printf("failed to close store: %v", err)
+	}
+
 	log.Println("Server gracefully stopped.")
 }
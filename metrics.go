@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total HTTP requests processed, labeled by method, route and status code.",
+	}, []string{"method", "path", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	kvStoreSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kv_store_size",
+		Help: "Number of keys currently held by the store.",
+	})
+
+	kvOperationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_operations_total",
+		Help: "Total key/value operations, labeled by operation (put, delete, cas).",
+	}, []string{"op"})
+)
+
+// statusRecorder captures the status code a handler wrote so metricsMiddleware
+// can label http_requests_total without the handler reporting it itself.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack passes through to the wrapped writer so websocket upgrades on /ws
+// still work behind metricsMiddleware.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("statusRecorder: underlying ResponseWriter does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// metricsMiddleware records http_requests_total and http_request_duration_seconds
+// for every request. It reads from chi's route context rather than Server
+// state, so it adds no lock contention on the read path.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		path := r.URL.Path
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			path = rc.RoutePattern()
+		}
+
+		httpRequestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, path).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrKeyNotFound is returned (possibly wrapped) by Store.Delete when the key
+// does not exist. Get reports a missing or expired key through its ok result
+// instead of this error.
+var ErrKeyNotFound = errors.New("key not found")
+
+// StoreStats reports basic bookkeeping numbers about a Store, used by the
+// /stats endpoint and the background worker's kv_store_size gauge.
+type StoreStats struct {
+	Keys int
+	Size int64
+}
+
+// KVPair is one entry returned by Store.ListPrefix.
+type KVPair struct {
+	Key   string
+	Value string
+}
+
+// Store is the persistence backend for the key/value data served under
+// /data. Implementations must be safe for concurrent use; any locking that
+// used to happen around the in-memory map now lives inside each
+// implementation instead of in Server.
+type Store interface {
+	Get(key string) (value string, ok bool, err error)
+	Put(key, value string) error
+	// PutTTL stores value under key, expiring it automatically after ttl.
+	// ttl <= 0 means the entry never expires.
+	PutTTL(key, value string, ttl time.Duration) error
+	// BulkPut writes every key/value pair in items in one call. The badger
+	// store commits them in a single transaction (all or none); the fs store
+	// writes them one key at a time under its write lock, so on error the
+	// keys written before it stay, and a concurrent Get can see part of a
+	// batch.
+	BulkPut(items map[string]string) error
+	Delete(key string) error
+	// CAS stores newValue under key only if the current value equals
+	// expected (an absent key counts as expected == ""). It reports
+	// whether the swap happened.
+	CAS(key, expected, newValue string) (swapped bool, err error)
+	// Iterate calls fn once per stored key/value pair. Iteration stops and
+	// returns the first error fn returns.
+	Iterate(fn func(key, value string) error) error
+	// ListPrefix returns up to limit keys >= cursor with the given prefix,
+	// in sorted order, plus the cursor to pass back for the next page (""
+	// once there are no more matches).
+	ListPrefix(prefix, cursor string, limit int) (items []KVPair, nextCursor string, err error)
+	Stats() (StoreStats, error)
+	Close() error
+}
+
+// expired lets implementations that store a TTL alongside the value
+// share the same "is this entry stale" logic.
+func expired(at time.Time) bool {
+	return !at.IsZero() && time.Now().After(at)
+}
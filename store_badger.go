@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// badgerStore is a Store backed by an embedded BadgerDB instance. Expiry is
+// delegated to Badger's own TTL/value-log GC rather than a manual sweep.
+type badgerStore struct {
+	db *badger.DB
+}
+
+// NewBadgerStore opens (creating if necessary) a BadgerDB database at dir.
+func NewBadgerStore(dir string) (*badgerStore, error) {
+	opts := badger.DefaultOptions(dir).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("badgerstore: open %s: %w", dir, err)
+	}
+	return &badgerStore{db: db}, nil
+}
+
+func (s *badgerStore) Get(key string) (string, bool, error) {
+	var value string
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			value = string(val)
+			return nil
+		})
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("badgerstore: get %s: %w", key, err)
+	}
+	if value == "" {
+		ok, err := s.exists(key)
+		return value, ok, err
+	}
+	return value, true, nil
+}
+
+func (s *badgerStore) exists(key string) (bool, error) {
+	var ok bool
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok = true
+		return nil
+	})
+	return ok, err
+}
+
+func (s *badgerStore) Put(key, value string) error {
+	return s.PutTTL(key, value, 0)
+}
+
+// PutTTL stores value with an optional expiry; ttl <= 0 means "forever".
+func (s *badgerStore) PutTTL(key, value string, ttl time.Duration) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry([]byte(key), []byte(value))
+		if ttl > 0 {
+			entry = entry.WithTTL(ttl)
+		}
+		return txn.SetEntry(entry)
+	})
+	if err != nil {
+		return fmt.Errorf("badgerstore: put %s: %w", key, err)
+	}
+	return nil
+}
+
+// BulkPut writes every pair in items inside a single transaction, so either
+// all of them commit or (on conflict/error) none do.
+func (s *badgerStore) BulkPut(items map[string]string) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		for key, value := range items {
+			if err := txn.SetEntry(badger.NewEntry([]byte(key), []byte(value))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("badgerstore: bulk put: %w", err)
+	}
+	return nil
+}
+
+// CAS stores newValue under key only if the current value equals expected.
+// Badger's transaction conflict detection makes the read-then-write atomic
+// even without an explicit lock.
+func (s *badgerStore) CAS(key, expected, newValue string) (bool, error) {
+	var swapped bool
+	err := s.db.Update(func(txn *badger.Txn) error {
+		current := ""
+		var expiresAt uint64
+		item, err := txn.Get([]byte(key))
+		switch {
+		case err == badger.ErrKeyNotFound:
+			// current stays "", expiresAt stays 0 (no prior TTL)
+		case err != nil:
+			return err
+		default:
+			expiresAt = item.ExpiresAt()
+			if verr := item.Value(func(val []byte) error {
+				current = string(val)
+				return nil
+			}); verr != nil {
+				return verr
+			}
+		}
+
+		if current != expected {
+			return nil
+		}
+		swapped = true
+
+		// Swap the value but keep whatever TTL the key already had.
+		entry := badger.NewEntry([]byte(key), []byte(newValue))
+		if expiresAt > 0 {
+			if remaining := time.Until(time.Unix(int64(expiresAt), 0)); remaining > 0 {
+				entry = entry.WithTTL(remaining)
+			}
+		}
+		return txn.SetEntry(entry)
+	})
+	if err != nil {
+		return false, fmt.Errorf("badgerstore: cas %s: %w", key, err)
+	}
+	return swapped, nil
+}
+
+func (s *badgerStore) Delete(key string) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return txn.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("badgerstore: delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStore) Iterate(fn func(key, value string) error) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.KeyCopy(nil))
+			err := item.Value(func(val []byte) error {
+				return fn(key, string(val))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("badgerstore: iterate: %w", err)
+	}
+	return nil
+}
+
+// ListPrefix returns up to limit keys >= cursor with the given prefix.
+// Badger's LSM keeps keys in sorted order, so this is a straightforward
+// seek-and-scan with no separate index needed.
+func (s *badgerStore) ListPrefix(prefix, cursor string, limit int) ([]KVPair, string, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	seek := prefix
+	if cursor > seek {
+		seek = cursor
+	}
+
+	var items []KVPair
+	nextCursor := ""
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(seek)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			item := it.Item()
+			key := string(item.KeyCopy(nil))
+			if len(items) == limit {
+				nextCursor = key
+				break
+			}
+			err := item.Value(func(val []byte) error {
+				items = append(items, KVPair{Key: key, Value: string(val)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("badgerstore: list prefix %q: %w", prefix, err)
+	}
+	return items, nextCursor, nil
+}
+
+func (s *badgerStore) Stats() (StoreStats, error) {
+	lsm, vlog := s.db.Size()
+
+	var count int
+	err := s.Iterate(func(string, string) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return StoreStats{}, err
+	}
+
+	return StoreStats{Keys: count, Size: lsm + vlog}, nil
+}
+
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fsStore is a directory-sharded filesystem store: each key is hashed to a
+// two-level hex prefix directory (similar to the disk-store layout syncthing
+// uses for its crash receiver) so a single directory never ends up with an
+// unreasonable number of entries. Writes are atomic: the shard file is
+// written to a temp file in the same directory and renamed into place.
+//
+// fnvHex isn't collision-resistant and keys are attacker-controlled, so a
+// shard file holds a slice of records rather than a single one: two keys
+// that happen to hash to the same shard just both live in that file, each
+// looked up by comparing its own Key field rather than trusting the shard
+// as a stand-in for key identity.
+//
+// Because the shard layout is keyed by hash rather than by key order, prefix
+// scans are served from an in-memory sorted index instead of walking shards.
+type fsStore struct {
+	root string
+
+	mu    sync.Mutex
+	size  int64    // total bytes of all shard files on disk
+	index []string // sorted keys currently on disk (excluding known-expired ones)
+}
+
+// fsRecord is one key's entry within a shard file. Key is stored alongside
+// Value because the shard file name is a hash of the key, not the key
+// itself, and because a shard can hold more than one key's record if their
+// hashes collide.
+type fsRecord struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// NewFSStore creates a filesystem-backed Store rooted at dir, creating it if
+// necessary and indexing whatever is already there.
+func NewFSStore(dir string) (*fsStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("fsstore: create root: %w", err)
+	}
+	s := &fsStore{root: dir}
+	if err := s.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fsStore) rebuildIndex() error {
+	var total int64
+	var keys []string
+
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		total += info.Size()
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		var records []fsRecord
+		if err := json.Unmarshal(raw, &records); err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+		for _, rec := range records {
+			if !expired(rec.ExpiresAt) {
+				keys = append(keys, rec.Key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fsstore: walk root: %w", err)
+	}
+
+	sort.Strings(keys)
+	s.size = total
+	s.index = keys
+	return nil
+}
+
+// shardPath returns the two-level hex prefix directory and file path for key,
+// e.g. root/3a/f1/<digest>.json for a key whose fnvHex digest starts with
+// "3af1", the file being named after the whole digest. The file
+// may also hold records for other keys, if their hashes collide with key's.
+func (s *fsStore) shardPath(key string) (dir, file string) {
+	h := fnvHex(key)
+	dir = filepath.Join(s.root, h[0:2], h[2:4])
+	file = filepath.Join(dir, h+".json")
+	return dir, file
+}
+
+// readShard returns every record currently stored in a shard file, or nil if
+// the file doesn't exist. It's a plain file read with no locking of its own;
+// the atomic rename in writeShardLocked guarantees a concurrent read sees
+// either the old or the new contents, never a partial write.
+func (s *fsStore) readShard(file string) ([]fsRecord, error) {
+	raw, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []fsRecord
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// findRecord returns the record in records whose Key matches key, if any.
+func findRecord(records []fsRecord, key string) (fsRecord, bool) {
+	for _, rec := range records {
+		if rec.Key == key {
+			return rec, true
+		}
+	}
+	return fsRecord{}, false
+}
+
+func (s *fsStore) Get(key string) (string, bool, error) {
+	_, file := s.shardPath(key)
+
+	records, err := s.readShard(file)
+	if err != nil {
+		return "", false, fmt.Errorf("fsstore: read %s: %w", key, err)
+	}
+	rec, ok := findRecord(records, key)
+	if !ok {
+		return "", false, nil
+	}
+	if expired(rec.ExpiresAt) {
+		_ = s.Delete(key)
+		return "", false, nil
+	}
+	return rec.Value, true, nil
+}
+
+func (s *fsStore) Put(key, value string) error {
+	return s.PutTTL(key, value, 0)
+}
+
+func (s *fsStore) PutTTL(key, value string, ttl time.Duration) error {
+	rec := fsRecord{Key: key, Value: value}
+	if ttl > 0 {
+		rec.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putRecordLocked(key, rec)
+}
+
+// BulkPut writes every pair in items under a single lock acquisition, so no
+// other Put/Delete/CAS/BulkPut can interleave with it. Each individual key
+// still lands via the same read-shard, replace-in-slice, write-shard
+// sequence as Put; there is no cross-key rollback on a mid-batch error (the
+// filesystem gives us no multi-file transaction). Get reads shard files
+// without taking s.mu, so a concurrent Get can see some of the batch's keys
+// before the rest have landed.
+func (s *fsStore) BulkPut(items map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, value := range items {
+		if err := s.putRecordLocked(key, fsRecord{Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putRecordLocked writes rec for key, replacing any existing record for key
+// within its shard and leaving other keys that happen to hash to the same
+// shard (an FNV-1a collision) untouched. Callers must hold s.mu.
+func (s *fsStore) putRecordLocked(key string, rec fsRecord) error {
+	dir, file := s.shardPath(key)
+
+	records, err := s.readShard(file)
+	if err != nil {
+		return fmt.Errorf("fsstore: read shard for %s: %w", key, err)
+	}
+
+	existed := false
+	for i, r := range records {
+		if r.Key == key {
+			records[i] = rec
+			existed = true
+			break
+		}
+	}
+	if !existed {
+		records = append(records, rec)
+	}
+
+	if err := s.writeShardLocked(dir, file, records); err != nil {
+		return err
+	}
+	if !existed {
+		s.insertIndexLocked(key)
+	}
+	return nil
+}
+
+// writeShardLocked atomically replaces file's contents with records (temp
+// file + rename in dir) and updates s.size for the delta. An empty records
+// slice removes the file instead of writing an empty array. Callers must
+// hold s.mu.
+func (s *fsStore) writeShardLocked(dir, file string, records []fsRecord) error {
+	var prevSize int64
+	if info, err := os.Stat(file); err == nil {
+		prevSize = info.Size()
+	}
+
+	if len(records) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("fsstore: remove empty shard: %w", err)
+		}
+		s.size -= prevSize
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("fsstore: create shard: %w", err)
+	}
+
+	raw, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("fsstore: encode shard: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("fsstore: create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("fsstore: write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("fsstore: close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("fsstore: rename into place: %w", err)
+	}
+
+	s.size += int64(len(raw)) - prevSize
+	return nil
+}
+
+func (s *fsStore) insertIndexLocked(key string) {
+	i := sort.SearchStrings(s.index, key)
+	if i < len(s.index) && s.index[i] == key {
+		return
+	}
+	s.index = append(s.index, "")
+	copy(s.index[i+1:], s.index[i:])
+	s.index[i] = key
+}
+
+func (s *fsStore) removeIndexLocked(key string) {
+	i := sort.SearchStrings(s.index, key)
+	if i < len(s.index) && s.index[i] == key {
+		s.index = append(s.index[:i], s.index[i+1:]...)
+	}
+}
+
+// readRecordLocked reads the current, non-expired record for key, if any.
+// Callers must hold s.mu.
+func (s *fsStore) readRecordLocked(key string) (fsRecord, bool, error) {
+	_, file := s.shardPath(key)
+
+	records, err := s.readShard(file)
+	if err != nil {
+		return fsRecord{}, false, fmt.Errorf("fsstore: read %s: %w", key, err)
+	}
+	rec, ok := findRecord(records, key)
+	if !ok || expired(rec.ExpiresAt) {
+		return fsRecord{}, false, nil
+	}
+	return rec, true, nil
+}
+
+// CAS stores newValue under key only if the current value equals expected.
+func (s *fsStore) CAS(key, expected, newValue string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok, err := s.readRecordLocked(key)
+	if err != nil {
+		return false, err
+	}
+	current := ""
+	if ok {
+		current = rec.Value
+	}
+	if current != expected {
+		return false, nil
+	}
+
+	// Preserve whatever TTL the key already had; CAS swaps the value, not
+	// the expiry.
+	newRec := fsRecord{Key: key, Value: newValue}
+	if ok {
+		newRec.ExpiresAt = rec.ExpiresAt
+	}
+	if err := s.putRecordLocked(key, newRec); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *fsStore) Delete(key string) error {
+	dir, file := s.shardPath(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.readShard(file)
+	if err != nil {
+		return fmt.Errorf("fsstore: read shard for %s: %w", key, err)
+	}
+
+	idx := -1
+	for i, r := range records {
+		if r.Key == key {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return ErrKeyNotFound
+	}
+	records = append(records[:idx], records[idx+1:]...)
+
+	if err := s.writeShardLocked(dir, file, records); err != nil {
+		return err
+	}
+	s.removeIndexLocked(key)
+	return nil
+}
+
+func (s *fsStore) Iterate(fn func(key, value string) error) error {
+	s.mu.Lock()
+	keys := make([]string, len(s.index))
+	copy(keys, s.index)
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		value, ok, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPrefix returns up to limit keys >= cursor with the given prefix, using
+// the in-memory sorted index rather than walking shard directories.
+func (s *fsStore) ListPrefix(prefix, cursor string, limit int) ([]KVPair, string, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	s.mu.Lock()
+	start := sort.SearchStrings(s.index, cursor)
+	keys := make([]string, len(s.index)-start)
+	copy(keys, s.index[start:])
+	s.mu.Unlock()
+
+	var items []KVPair
+	nextCursor := ""
+	for _, key := range keys {
+		if !hasPrefix(key, prefix) {
+			if key > prefix {
+				break // keys are sorted, so nothing further can match
+			}
+			continue
+		}
+		if len(items) == limit {
+			nextCursor = key
+			break
+		}
+		value, ok, err := s.Get(key)
+		if err != nil {
+			return nil, "", err
+		}
+		if !ok {
+			continue
+		}
+		items = append(items, KVPair{Key: key, Value: value})
+	}
+
+	return items, nextCursor, nil
+}
+
+func hasPrefix(key, prefix string) bool {
+	return len(key) >= len(prefix) && key[:len(prefix)] == prefix
+}
+
+// sweepExpired removes any on-disk records past their TTL. It is called
+// periodically by the background worker. A shard file with a mix of
+// expired and live keys (an FNV-1a collision where only one of the
+// colliding keys has expired) is rewritten with just the expired ones
+// dropped, rather than the whole file being deleted.
+func (s *fsStore) sweepExpired() error {
+	var staleFiles []string
+
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil // best effort; skip unreadable files
+		}
+		var records []fsRecord
+		if err := json.Unmarshal(raw, &records); err != nil {
+			return nil
+		}
+		for _, rec := range records {
+			if expired(rec.ExpiresAt) {
+				staleFiles = append(staleFiles, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fsstore: sweep: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range staleFiles {
+		dir := filepath.Dir(file)
+
+		records, err := s.readShard(file)
+		if err != nil {
+			continue // best effort
+		}
+
+		kept := records[:0]
+		for _, rec := range records {
+			if expired(rec.ExpiresAt) {
+				s.removeIndexLocked(rec.Key)
+				continue
+			}
+			kept = append(kept, rec)
+		}
+		_ = s.writeShardLocked(dir, file, kept)
+	}
+	return nil
+}
+
+func (s *fsStore) Stats() (StoreStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StoreStats{Keys: len(s.index), Size: s.size}, nil
+}
+
+func (s *fsStore) Close() error {
+	return nil
+}
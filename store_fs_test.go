@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+// TestFSStoreShardCollisionKeepsBothKeys simulates two keys whose fnvHex
+// digests collide (the scenario putRecordLocked/readShard/findRecord guard
+// against) by writing a second record straight into an existing key's shard
+// file, the way putRecordLocked would if fnvHex("key-one") happened to equal
+// fnvHex("key-two"). Both keys must resolve to their own record rather than
+// whichever was written to the shared shard last.
+func TestFSStoreShardCollisionKeepsBothKeys(t *testing.T) {
+	s, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStore: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Put("key-one", "value-one"); err != nil {
+		t.Fatalf("Put key-one: %v", err)
+	}
+
+	dir, file := s.shardPath("key-one")
+	records, err := s.readShard(file)
+	if err != nil {
+		t.Fatalf("readShard: %v", err)
+	}
+	records = append(records, fsRecord{Key: "key-two", Value: "value-two"})
+	if err := s.writeShardLocked(dir, file, records); err != nil {
+		t.Fatalf("writeShardLocked: %v", err)
+	}
+
+	records, err = s.readShard(file)
+	if err != nil {
+		t.Fatalf("readShard: %v", err)
+	}
+	if rec, ok := findRecord(records, "key-one"); !ok || rec.Value != "value-one" {
+		t.Fatalf("findRecord key-one in shared shard: rec=%+v ok=%v", rec, ok)
+	}
+	if rec, ok := findRecord(records, "key-two"); !ok || rec.Value != "value-two" {
+		t.Fatalf("findRecord key-two in shared shard: rec=%+v ok=%v", rec, ok)
+	}
+
+	// Get("key-one") is the one path that genuinely routes through
+	// shardPath("key-one") in this test, so it's the one real end-to-end
+	// check: it must return key-one's own value, not silently pick up
+	// key-two's just because they now share a file.
+	v1, ok1, err := s.Get("key-one")
+	if err != nil || !ok1 || v1 != "value-one" {
+		t.Fatalf("Get key-one: value=%q ok=%v err=%v", v1, ok1, err)
+	}
+
+	if err := s.Delete("key-one"); err != nil {
+		t.Fatalf("Delete key-one: %v", err)
+	}
+	if _, ok, err := s.Get("key-one"); err != nil || ok {
+		t.Fatalf("Get key-one after delete: ok=%v err=%v, want gone", ok, err)
+	}
+
+	// Deleting key-one must only remove its own record from the shared
+	// shard, not the whole file (which would take key-two down with it).
+	records, err = s.readShard(file)
+	if err != nil {
+		t.Fatalf("readShard after delete: %v", err)
+	}
+	if rec, ok := findRecord(records, "key-two"); !ok || rec.Value != "value-two" {
+		t.Fatalf("findRecord key-two after deleting its colliding neighbor: rec=%+v ok=%v", rec, ok)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// storeConstructors lists every Store backend these tests run against, so
+// behavior fixed in one implementation (CAS dropping TTL, cursor pagination
+// off-by-ones) can't silently regress in the other.
+var storeConstructors = []struct {
+	name string
+	new  func(t *testing.T) Store
+}{
+	{"fs", newFSStoreForTest},
+	{"badger", newBadgerStoreForTest},
+}
+
+func newFSStoreForTest(t *testing.T) Store {
+	t.Helper()
+	s, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStore: %v", err)
+	}
+	return s
+}
+
+func newBadgerStoreForTest(t *testing.T) Store {
+	t.Helper()
+	s, err := NewBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBadgerStore: %v", err)
+	}
+	return s
+}
+
+func TestStoreCASPreservesTTL(t *testing.T) {
+	for _, tc := range storeConstructors {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.new(t)
+			defer s.Close()
+
+			// badger's TTL has second-level granularity, so anything much
+			// shorter than a second risks expiring between the PutTTL and
+			// the CAS call below; give it enough headroom to be reliable.
+			const ttl = 1100 * time.Millisecond
+
+			if err := s.PutTTL("k", "v1", ttl); err != nil {
+				t.Fatalf("PutTTL: %v", err)
+			}
+
+			swapped, err := s.CAS("k", "v1", "v2")
+			if err != nil {
+				t.Fatalf("CAS: %v", err)
+			}
+			if !swapped {
+				t.Fatal("CAS: expected the swap to happen")
+			}
+
+			value, ok, err := s.Get("k")
+			if err != nil || !ok || value != "v2" {
+				t.Fatalf("Get right after CAS: value=%q ok=%v err=%v", value, ok, err)
+			}
+
+			time.Sleep(ttl + 500*time.Millisecond)
+
+			_, ok, err = s.Get("k")
+			if err != nil {
+				t.Fatalf("Get after expiry: %v", err)
+			}
+			if ok {
+				t.Fatal("CAS dropped the key's TTL: it is still readable past its original expiry")
+			}
+		})
+	}
+}
+
+func TestStoreCASRejectsMismatch(t *testing.T) {
+	for _, tc := range storeConstructors {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.new(t)
+			defer s.Close()
+
+			if err := s.Put("k", "v1"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			swapped, err := s.CAS("k", "wrong", "v2")
+			if err != nil {
+				t.Fatalf("CAS: %v", err)
+			}
+			if swapped {
+				t.Fatal("CAS swapped despite a mismatched expected value")
+			}
+
+			value, _, err := s.Get("k")
+			if err != nil || value != "v1" {
+				t.Fatalf("Get after rejected CAS: value=%q err=%v", value, err)
+			}
+		})
+	}
+}
+
+func TestStoreCASOnMissingKey(t *testing.T) {
+	for _, tc := range storeConstructors {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.new(t)
+			defer s.Close()
+
+			swapped, err := s.CAS("missing", "", "v1")
+			if err != nil {
+				t.Fatalf("CAS: %v", err)
+			}
+			if !swapped {
+				t.Fatal("CAS: expected swap when expected==\"\" matches an absent key")
+			}
+
+			value, ok, err := s.Get("missing")
+			if err != nil || !ok || value != "v1" {
+				t.Fatalf("Get after CAS-create: value=%q ok=%v err=%v", value, ok, err)
+			}
+		})
+	}
+}
+
+func TestStoreListPrefixCursorBoundary(t *testing.T) {
+	for _, tc := range storeConstructors {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.new(t)
+			defer s.Close()
+
+			keys := []string{"item/a", "item/b", "item/c", "item/d", "other/z"}
+			for _, k := range keys {
+				if err := s.Put(k, k); err != nil {
+					t.Fatalf("Put %s: %v", k, err)
+				}
+			}
+
+			page1, cursor1, err := s.ListPrefix("item/", "", 2)
+			if err != nil {
+				t.Fatalf("ListPrefix page1: %v", err)
+			}
+			if len(page1) != 2 || page1[0].Key != "item/a" || page1[1].Key != "item/b" {
+				t.Fatalf("page1 = %+v, want [item/a item/b]", page1)
+			}
+			if cursor1 != "item/c" {
+				t.Fatalf("cursor1 = %q, want item/c", cursor1)
+			}
+
+			page2, cursor2, err := s.ListPrefix("item/", cursor1, 2)
+			if err != nil {
+				t.Fatalf("ListPrefix page2: %v", err)
+			}
+			if len(page2) != 2 || page2[0].Key != "item/c" || page2[1].Key != "item/d" {
+				t.Fatalf("page2 = %+v, want [item/c item/d]", page2)
+			}
+			if cursor2 != "" {
+				t.Fatalf("cursor2 = %q, want empty (no more pages)", cursor2)
+			}
+
+			// Exact limit: as many matches as the page size must not report
+			// a bogus next cursor pointing past the prefix.
+			exact, cursor3, err := s.ListPrefix("item/", "", 4)
+			if err != nil {
+				t.Fatalf("ListPrefix exact: %v", err)
+			}
+			if len(exact) != 4 {
+				t.Fatalf("exact = %+v, want 4 items", exact)
+			}
+			if cursor3 != "" {
+				t.Fatalf("cursor3 = %q, want empty when the result exactly fills the page", cursor3)
+			}
+		})
+	}
+}